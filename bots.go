@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// BotConfig is one entry of the multi-bot config: a name operators refer to
+// it by (in source and target assignments) and its Telegram bot token.
+type BotConfig struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+// loadBots reads the multi-bot list from the file named by
+// TELEGRAM_BOTS_CONFIG. When that's unset, it falls back to a single bot
+// named "default" using TELEGRAM_BOT_TOKEN, preserving single-token setups.
+func loadBots() ([]BotConfig, error) {
+	path := os.Getenv("TELEGRAM_BOTS_CONFIG")
+	if path == "" {
+		token := os.Getenv("TELEGRAM_BOT_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN is not set in .env file")
+		}
+		return []BotConfig{{Name: "default", Token: token}}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading bots config file: %v", err)
+	}
+
+	var parsed struct {
+		Bots []BotConfig `json:"bots"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("error parsing bots config file: %v", err)
+	}
+	if len(parsed.Bots) == 0 {
+		return nil, fmt.Errorf("bots config file %s has no bots", path)
+	}
+	for i, b := range parsed.Bots {
+		if b.Name == "" {
+			return nil, fmt.Errorf("bot at index %d missing required name", i)
+		}
+		if b.Token == "" {
+			return nil, fmt.Errorf("bot %q missing required token", b.Name)
+		}
+	}
+	return parsed.Bots, nil
+}
+
+// BotSet holds one live tgbotapi.BotAPI per configured bot, keyed by name, so
+// a message received by one bot can be forwarded through another (e.g. to a
+// channel only that other bot is a member of).
+type BotSet struct {
+	byName      map[string]*tgbotapi.BotAPI
+	names       []string
+	defaultName string
+}
+
+func newBotSet(bots []BotConfig) (*BotSet, error) {
+	set := &BotSet{byName: make(map[string]*tgbotapi.BotAPI, len(bots))}
+	for _, b := range bots {
+		api, err := tgbotapi.NewBotAPI(b.Token)
+		if err != nil {
+			return nil, fmt.Errorf("error creating bot %q: %v", b.Name, err)
+		}
+		api.Debug = true
+		set.byName[b.Name] = api
+		set.names = append(set.names, b.Name)
+	}
+	if len(set.names) == 0 {
+		return nil, fmt.Errorf("no bots configured")
+	}
+	set.defaultName = set.names[0]
+	return set, nil
+}
+
+// Names returns every configured bot name, in config order.
+func (s *BotSet) Names() []string {
+	return s.names
+}
+
+// Get returns the bot registered under name, if any.
+func (s *BotSet) Get(name string) (*tgbotapi.BotAPI, bool) {
+	bot, ok := s.byName[name]
+	return bot, ok
+}
+
+// resolve returns the bot that should deliver to a target: the named bot if
+// one was given and exists, otherwise the first configured bot.
+func (s *BotSet) resolve(name string) (*tgbotapi.BotAPI, string) {
+	if name == "" {
+		name = s.defaultName
+	}
+	if bot, ok := s.byName[name]; ok {
+		return bot, name
+	}
+	log.Printf("Unknown bot %q, falling back to default bot %q", name, s.defaultName)
+	return s.byName[s.defaultName], s.defaultName
+}
@@ -4,109 +4,375 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
+	"github.com/sahilm/fuzzy"
 )
 
 type Source struct {
-	Type     string  `json:"type"`
-	ID       int64   `json:"id,omitempty"`
-	Username string  `json:"username,omitempty"`
-	UserIDs  []int64 `json:"user_ids,omitempty"`
+	Type     string
+	ID       int64
+	Username string
+	UserIDs  []int64
+
+	// BotName is the bot this source was added through, and the only bot
+	// whose updates are checked against it (a bot can only read messages in
+	// chats it has joined).
+	BotName string
+
+	// Targets overrides, for this source, which channel(s) matched messages
+	// are forwarded to and which bot delivers each one. When empty,
+	// Config.TargetChannelID via BotName is used.
+	Targets []Target
+
+	// Filters gates which of this source's messages get forwarded. A nil
+	// Filters forwards everything, preserving the pre-filter behavior.
+	Filters *Filters
 }
 
-type Config struct {
-	TargetChannelID int64    `json:"target_channel_id"`
-	Sources         []Source `json:"sources"`
+// Target is one forwarding destination: a channel ID and, optionally, the
+// name of the bot that should deliver to it. An empty BotName means "the
+// same bot that owns the source".
+type Target struct {
+	ChannelID int64
+	BotName   string
 }
 
-func loadConfig(filename string) (*Config, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %v", err)
+// Filters holds a source's content filters. IncludeRegexes is compiled once,
+// by compile, when sources are loaded or reloaded rather than per message.
+type Filters struct {
+	IncludeKeywords []string
+	ExcludeKeywords []string
+	IncludeRegexes  []string
+	FuzzyInclude    []string
+	MessageTypes    []string
+
+	compiled []*regexp.Regexp
+}
+
+func (f *Filters) compile() error {
+	f.compiled = make([]*regexp.Regexp, 0, len(f.IncludeRegexes))
+	for _, pattern := range f.IncludeRegexes {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %v", pattern, err)
+		}
+		f.compiled = append(f.compiled, re)
+	}
+	return nil
+}
+
+// allows reports whether message passes every configured filter. A nil
+// Filters allows everything.
+func (f *Filters) allows(message *tgbotapi.Message) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.MessageTypes) > 0 && !messageTypeMatches(message, f.MessageTypes) {
+		return false
 	}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("error parsing config file: %v", err)
+	text := message.Text
+	if text == "" {
+		text = message.Caption
 	}
 
-	// Clean up usernames (remove @ if present)
-	for i := range config.Sources {
-		if (config.Sources[i].Type == "group" || config.Sources[i].Type == "public_group") && config.Sources[i].Username != "" {
-			config.Sources[i].Username = strings.TrimPrefix(config.Sources[i].Username, "@")
+	for _, keyword := range f.ExcludeKeywords {
+		if containsFold(text, keyword) {
+			return false
 		}
 	}
 
-	// Validation
-	for i, source := range config.Sources {
-		switch source.Type {
-		case "channel":
-			if source.ID == 0 {
-				return nil, fmt.Errorf("channel source at index %d missing required ID", i)
+	if len(f.IncludeKeywords) > 0 && !anyContainsFold(text, f.IncludeKeywords) {
+		return false
+	}
+
+	if len(f.compiled) > 0 {
+		matched := false
+		for _, re := range f.compiled {
+			if re.MatchString(text) {
+				matched = true
+				break
 			}
-		case "group":
-			if source.ID == 0 {
-				return nil, fmt.Errorf("group source at index %d missing required ID", i)
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(f.FuzzyInclude) > 0 && !fuzzyMatchesAny(text, f.FuzzyInclude) {
+		return false
+	}
+
+	return true
+}
+
+func containsFold(text, keyword string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(keyword))
+}
+
+func anyContainsFold(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if containsFold(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzzyMatchesAny reports whether any word of text fuzzy-matches any of the
+// given keywords, using sahilm/fuzzy's fzf-style subsequence matching.
+func fuzzyMatchesAny(text string, keywords []string) bool {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return false
+	}
+	for _, keyword := range keywords {
+		if len(fuzzy.Find(keyword, words)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// messageTypeMatches reports whether message is any of the allowed types:
+// text, photo, video, document or link (a message containing a URL).
+func messageTypeMatches(message *tgbotapi.Message, allowed []string) bool {
+	for _, t := range allowed {
+		switch t {
+		case "text":
+			if message.Text != "" {
+				return true
 			}
-			if len(source.UserIDs) == 0 {
-				return nil, fmt.Errorf("group source at index %d missing required user_ids", i)
+		case "photo":
+			if message.Photo != nil {
+				return true
 			}
-		case "public_group":
-			if source.Username == "" {
-				return nil, fmt.Errorf("public_group source at index %d missing required username", i)
+		case "video":
+			if message.Video != nil {
+				return true
 			}
-			if len(source.UserIDs) == 0 {
-				return nil, fmt.Errorf("public_group source at index %d missing required user_ids", i)
+		case "document":
+			if message.Document != nil {
+				return true
 			}
-		case "user":
-			if len(source.UserIDs) == 0 {
-				return nil, fmt.Errorf("user source at index %d missing required user_ids", i)
+		case "link":
+			if containsLink(message) {
+				return true
 			}
-		default:
-			return nil, fmt.Errorf("unknown source type at index %d: %s", i, source.Type)
 		}
 	}
+	return false
+}
+
+func containsLink(message *tgbotapi.Message) bool {
+	for _, entity := range append(message.Entities, message.CaptionEntities...) {
+		if entity.Type == "url" || entity.Type == "text_link" {
+			return true
+		}
+	}
+	return false
+}
+
+// Config holds the bot's runtime settings. Sources is mutable: operator
+// commands (see handleSourceCommand) add to and remove from the backing
+// SourceStore and then refresh this in-memory snapshot, so it's guarded by
+// mu since it's read from both the update dispatch loop and, in webhook
+// mode, concurrent HTTP handlers.
+type Config struct {
+	TargetChannelID int64
+	AdminUserID     int64
+
+	Bots *BotSet
+
+	store *SourceStore
+	queue *ForwardQueue
 
-	return &config, nil
+	mu      sync.RWMutex
+	Sources []Source
+}
+
+func loadConfig() (*Config, error) {
+	targetChannelID, err := parseEnvInt64("TELEGRAM_TARGET_CHANNEL_ID")
+	if err != nil {
+		return nil, err
+	}
+
+	adminUserID, err := parseEnvInt64("TELEGRAM_ADMIN_USER_ID")
+	if err != nil {
+		return nil, err
+	}
+
+	dbPath := os.Getenv("TELEGRAM_DB_PATH")
+	if dbPath == "" {
+		dbPath = "sources.db"
+	}
+
+	store, err := openSourceStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	queue, err := openForwardQueue(store.DB())
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{
+		TargetChannelID: targetChannelID,
+		AdminUserID:     adminUserID,
+		store:           store,
+		queue:           queue,
+	}
+	if err := config.reloadSources(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func parseEnvInt64(name string) (int64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, fmt.Errorf("%s is not set in .env file", name)
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %v", name, err)
+	}
+	return parsed, nil
+}
+
+// reloadSources refreshes the in-memory source snapshot from the store.
+// Call it after any command that adds or removes a source.
+func (c *Config) reloadSources() error {
+	sources, err := c.store.List()
+	if err != nil {
+		return err
+	}
+
+	for i := range sources {
+		if sources[i].Filters == nil {
+			continue
+		}
+		// parseFilterArgs rejects bad regexes before they're persisted, so
+		// this should never fail in practice. Skip-and-log rather than
+		// log.Fatal on it anyway, so a filter that somehow made it into the
+		// store (e.g. written by hand) can't brick the process on restart.
+		if err := sources[i].Filters.compile(); err != nil {
+			log.Printf("Error compiling filters for source %d, forwarding unfiltered: %v", i+1, err)
+			sources[i].Filters = nil
+		}
+	}
+
+	c.mu.Lock()
+	c.Sources = sources
+	c.mu.Unlock()
+	return nil
+}
+
+// sourcesSnapshot returns a copy of the current source list, safe to range
+// over without holding a lock for the duration.
+func (c *Config) sourcesSnapshot() []Source {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	sources := make([]Source, len(c.Sources))
+	copy(sources, c.Sources)
+	return sources
+}
+
+// resolveTargets returns the destinations a matched message from source
+// should be forwarded to, falling back to the top-level default target
+// delivered through the source's own bot. A target with no explicit
+// BotName is delivered through the source's own bot.
+func (c *Config) resolveTargets(source Source) []Target {
+	if len(source.Targets) > 0 {
+		targets := make([]Target, len(source.Targets))
+		for i, t := range source.Targets {
+			if t.BotName == "" {
+				t.BotName = source.BotName
+			}
+			targets[i] = t
+		}
+		return targets
+	}
+	return []Target{{ChannelID: c.TargetChannelID, BotName: source.BotName}}
 }
 
 func main() {
-	// Load .env file for bot token
+	// Load .env file for bot token(s)
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file")
 	}
 
-	// Get bot token from environment variable
-	token := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if token == "" {
-		log.Fatal("TELEGRAM_BOT_TOKEN is not set in .env file")
+	// Load configuration: static settings from the environment, the
+	// monitored source list from the SQLite-backed store
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Load configuration from config.json
-	config, err := loadConfig("config.json")
+	// Load and connect every configured bot. Each bot can only read
+	// messages in chats it has joined, so a multi-community deployment
+	// typically runs one bot per community.
+	bots, err := loadBots()
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	// Create a new bot instance
-	bot, err := tgbotapi.NewBotAPI(token)
+	botSet, err := newBotSet(bots)
 	if err != nil {
 		log.Fatal(err)
 	}
+	config.Bots = botSet
 
-	// Enable debug mode
-	bot.Debug = true
+	go drainForwardQueue(config.queue, config.Bots, nil)
 
-	log.Printf("Authorized on account %s", bot.Self.UserName)
 	log.Printf("Monitoring for user IDs: %v", getAllUserIDs(config))
 
-	// Start a goroutine to monitor public groups
-	go monitorPublicGroups(bot, config)
+	mode := os.Getenv("TELEGRAM_MODE")
+	if mode == "" {
+		mode = "polling"
+	}
+
+	switch mode {
+	case "polling":
+		var wg sync.WaitGroup
+		for _, name := range botSet.Names() {
+			bot, _ := botSet.Get(name)
+			log.Printf("Authorized on account %s as bot %q", bot.Self.UserName, name)
+			go monitorPublicGroups(bot, name, config)
+
+			wg.Add(1)
+			go func(bot *tgbotapi.BotAPI, name string) {
+				defer wg.Done()
+				runPolling(bot, name, config)
+			}(bot, name)
+		}
+		wg.Wait()
+	case "webhook":
+		for _, name := range botSet.Names() {
+			bot, _ := botSet.Get(name)
+			log.Printf("Authorized on account %s as bot %q", bot.Self.UserName, name)
+			go monitorPublicGroups(bot, name, config)
+		}
+		runWebhooks(botSet, config)
+	default:
+		log.Fatalf("TELEGRAM_MODE must be \"polling\" or \"webhook\", got %q", mode)
+	}
+}
 
+// runPolling drives one bot's updates via long-polling, Telegram's default
+// delivery mode.
+func runPolling(bot *tgbotapi.BotAPI, botName string, config *Config) {
 	// Create update configuration with a longer timeout
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
@@ -117,22 +383,85 @@ func main() {
 
 	// Handle incoming updates
 	for update := range updates {
-		// Handle channel posts
-		if update.ChannelPost != nil {
-			handleChannelPost(bot, update.ChannelPost, config)
-			continue
-		}
+		dispatchUpdate(bot, botName, update, config)
+	}
+}
 
-		// Handle messages (including public group messages and direct messages)
-		if update.Message != nil {
-			handleMessage(bot, update.Message, config)
+// runWebhooks registers a webhook for every bot in botSet, one path per bot
+// name, and serves them all from a single HTTP server. This lets the bots
+// run behind a public HTTPS endpoint instead of polling.
+func runWebhooks(botSet *BotSet, config *Config) {
+	baseURL := os.Getenv("TELEGRAM_WEBHOOK_URL")
+	if baseURL == "" {
+		log.Fatal("TELEGRAM_WEBHOOK_URL is not set in .env file")
+	}
+
+	listenAddr := os.Getenv("TELEGRAM_WEBHOOK_LISTEN_ADDR")
+	if listenAddr == "" {
+		listenAddr = ":8080"
+	}
+
+	secretToken := os.Getenv("TELEGRAM_WEBHOOK_SECRET_TOKEN")
+
+	mux := http.NewServeMux()
+	for _, name := range botSet.Names() {
+		bot, _ := botSet.Get(name)
+		path := "/" + name
+		webhookURL := strings.TrimRight(baseURL, "/") + path
+
+		params := tgbotapi.Params{"url": webhookURL}
+		if secretToken != "" {
+			params["secret_token"] = secretToken
+		}
+		if _, err := bot.MakeRequest("setWebhook", params); err != nil {
+			log.Fatalf("Error setting webhook for bot %q: %v", name, err)
 		}
+		log.Printf("Webhook for bot %q registered at %s", name, webhookURL)
+
+		bot, name := bot, name // capture per iteration
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if secretToken != "" && r.Header.Get("X-Telegram-Bot-Api-Secret-Token") != secretToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			var update tgbotapi.Update
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				log.Printf("Error decoding webhook update for bot %q: %v", name, err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			dispatchUpdate(bot, name, update, config)
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+
+	log.Printf("Listening for webhook updates on %s", listenAddr)
+	if err := http.ListenAndServe(listenAddr, mux); err != nil {
+		log.Fatalf("Error serving webhooks: %v", err)
+	}
+}
+
+// dispatchUpdate routes a single update, received by the bot named botName,
+// to the channel-post or message handler, regardless of whether it arrived
+// via polling or webhook.
+func dispatchUpdate(bot *tgbotapi.BotAPI, botName string, update tgbotapi.Update, config *Config) {
+	// Handle channel posts
+	if update.ChannelPost != nil {
+		handleChannelPost(botName, update.ChannelPost, config)
+		return
+	}
+
+	// Handle messages (including public group messages and direct messages)
+	if update.Message != nil {
+		handleMessage(bot, botName, update.Message, config)
 	}
 }
 
 func getAllUserIDs(config *Config) []int64 {
 	userIDMap := make(map[int64]bool)
-	for _, source := range config.Sources {
+	for _, source := range config.sourcesSnapshot() {
 		for _, userID := range source.UserIDs {
 			userIDMap[userID] = true
 		}
@@ -145,7 +474,7 @@ func getAllUserIDs(config *Config) []int64 {
 	return userIDs
 }
 
-func handleChannelPost(bot *tgbotapi.BotAPI, post *tgbotapi.Message, config *Config) {
+func handleChannelPost(botName string, post *tgbotapi.Message, config *Config) {
 	log.Printf("Channel Post Details:")
 	log.Printf("  Channel ID: %d", post.Chat.ID)
 	log.Printf("  Channel Title: %s", post.Chat.Title)
@@ -153,15 +482,22 @@ func handleChannelPost(bot *tgbotapi.BotAPI, post *tgbotapi.Message, config *Con
 	log.Printf("-------------------")
 
 	// Check if post is from monitored channel
-	for _, source := range config.Sources {
+	for _, source := range config.sourcesSnapshot() {
+		if source.BotName != botName {
+			continue
+		}
 		if source.Type == "channel" && post.Chat.ID == source.ID {
-			forwardMessage(bot, config.TargetChannelID, post.Chat.ID, post.MessageID)
+			if !source.Filters.allows(post) {
+				log.Printf("Channel post from %d filtered out", post.Chat.ID)
+				break
+			}
+			forwardMessage(config, config.resolveTargets(source), post.Chat.ID, post.MessageID)
 			break
 		}
 	}
 }
 
-func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, config *Config) {
+func handleMessage(bot *tgbotapi.BotAPI, botName string, message *tgbotapi.Message, config *Config) {
 	// Log message details
 	log.Printf("Message Details:")
 	log.Printf("  Chat Username: %s", message.Chat.UserName)
@@ -175,19 +511,26 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, config *Conf
 
 	// Handle commands first
 	if message.IsCommand() {
-		handleCommand(bot, message)
+		handleCommand(bot, botName, message, config)
 		return
 	}
 
 	// If it's a direct message to the bot, check if from monitored user
 	if message.Chat.Type == "private" {
 		// Check if user is in monitored list
-		for _, source := range config.Sources {
+		for _, source := range config.sourcesSnapshot() {
+			if source.BotName != botName {
+				continue
+			}
 			if source.Type == "user" {
 				for _, userID := range source.UserIDs {
 					if message.From.ID == userID {
+						if !source.Filters.allows(message) {
+							log.Printf("Direct message from monitored user %d filtered out", message.From.ID)
+							return
+						}
 						log.Printf("Received direct message from monitored user %d", message.From.ID)
-						forwardMessage(bot, config.TargetChannelID, message.Chat.ID, message.MessageID)
+						forwardMessage(config, config.resolveTargets(source), message.Chat.ID, message.MessageID)
 						return
 					}
 				}
@@ -199,7 +542,10 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, config *Conf
 	// Handle messages from groups
 	if message.Chat.Type == "group" || message.Chat.Type == "supergroup" {
 		// Check if the group is in our monitored list and if user is monitored in that group
-		for _, source := range config.Sources {
+		for _, source := range config.sourcesSnapshot() {
+			if source.BotName != botName {
+				continue
+			}
 			if source.Type == "group" || source.Type == "public_group" {
 				// Check if this is the right group first
 				isMatchingGroup := false
@@ -223,8 +569,12 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, config *Conf
 
 					for _, userID := range source.UserIDs {
 						if message.From.ID == userID {
+							if !source.Filters.allows(message) {
+								log.Printf("Message from monitored user %d in group filtered out", message.From.ID)
+								return
+							}
 							log.Printf("Forwarding message from monitored user %d in group", message.From.ID)
-							forwardMessage(bot, config.TargetChannelID, message.Chat.ID, message.MessageID)
+							forwardMessage(config, config.resolveTargets(source), message.Chat.ID, message.MessageID)
 							return
 						}
 					}
@@ -241,15 +591,41 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message, config *Conf
 	}
 }
 
-func handleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+// sourceCommands are the operator-only commands that mutate the monitored
+// source list. They're restricted to config.AdminUserID.
+var sourceCommands = map[string]bool{
+	"addchannel":   true,
+	"addgroup":     true,
+	"adduser":      true,
+	"removesource": true,
+	"listsources":  true,
+	"setfilter":    true,
+	"clearfilter":  true,
+}
+
+func handleCommand(bot *tgbotapi.BotAPI, botName string, message *tgbotapi.Message, config *Config) {
 	msg := tgbotapi.NewMessage(message.Chat.ID, "")
 
-	switch message.Command() {
-	case "start":
+	switch {
+	case message.Command() == "start":
 		msg.Text = "Welcome! I'm monitoring messages and will forward them to the target channel if they match the criteria."
-	case "help":
+	case message.Command() == "help":
 		msg.Text = "Available commands:\n/start - Start the bot\n/help - Show this help message\n/id - Show chat information"
-	case "id":
+		if message.From.ID == config.AdminUserID {
+			msg.Text += "\n\nAdmin commands:\n" +
+				"/addchannel <id> [bot=<name>] [to <target_ids...>] - Monitor a channel\n" +
+				"/addgroup <id|@username> <user_ids...> [bot=<name>] [to <target_ids...>] - Monitor a group\n" +
+				"/adduser <user_id> [bot=<name>] [to <target_ids...>] - Monitor a user's direct messages\n" +
+				"/removesource <n> - Remove source n (see /listsources)\n" +
+				"/listsources - List monitored sources\n" +
+				"/setfilter <n> include=a,b exclude=c regex=d fuzzy=e types=text,photo,video,document,link - Set source n's content filters\n" +
+				"/clearfilter <n> - Remove source n's content filters\n\n" +
+				"A source is owned by the bot that added it, unless bot=<name> names a different\n" +
+				"configured bot. Target IDs may be \"<channel_id>\" or \"<channel_id>@<bot_name>\" to\n" +
+				"deliver through a bot other than the one that owns the source. Sources without an\n" +
+				"explicit \"to <target_ids...>\" forward to the default target channel via their own bot."
+		}
+	case message.Command() == "id":
 		msg.Text = fmt.Sprintf("Chat Username: %s\nChat ID: %d\nChat Title: %s\nChat Type: %s\nFrom User ID: %d\nFrom Username: %s",
 			message.Chat.UserName,
 			message.Chat.ID,
@@ -257,6 +633,12 @@ func handleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 			message.Chat.Type,
 			message.From.ID,
 			message.From.UserName)
+	case sourceCommands[message.Command()]:
+		if message.From.ID != config.AdminUserID {
+			msg.Text = "You're not authorized to manage sources."
+			break
+		}
+		msg.Text = handleSourceCommand(config, botName, message)
 	default:
 		msg.Text = "I don't know that command. Use /help to see available commands."
 	}
@@ -266,21 +648,332 @@ func handleCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	}
 }
 
-func forwardMessage(bot *tgbotapi.BotAPI, targetID, fromChatID int64, messageID int) {
-	forward := tgbotapi.NewForward(targetID, fromChatID, messageID)
-	if _, err := bot.Send(forward); err != nil {
-		log.Printf("Error forwarding message: %v", err)
-	} else {
-		log.Printf("Successfully forwarded message from chat %d", fromChatID)
+// handleSourceCommand implements the operator-only /addchannel, /addgroup,
+// /adduser, /removesource and /listsources commands, and returns the reply
+// text to send back to the admin. botName is the bot that received the
+// command, and is the default owning bot for any source added.
+func handleSourceCommand(config *Config, botName string, message *tgbotapi.Message) string {
+	args := strings.Fields(message.CommandArguments())
+
+	switch message.Command() {
+	case "addchannel":
+		if len(args) < 1 {
+			return "Usage: /addchannel <id> [bot=<name>] [to <target_ids...>]"
+		}
+		args, sourceBotName := extractBotOverride(args, botName)
+		rest, targets, err := splitTargetArgs(args)
+		if err != nil {
+			return err.Error()
+		}
+		if len(rest) != 1 {
+			return "Usage: /addchannel <id> [bot=<name>] [to <target_ids...>]"
+		}
+		id, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			return fmt.Sprintf("Invalid channel ID: %v", err)
+		}
+		if err := config.store.AddChannel(id, sourceBotName, targets); err != nil {
+			return fmt.Sprintf("Error adding channel: %v", err)
+		}
+		if err := config.reloadSources(); err != nil {
+			return fmt.Sprintf("Channel added but failed to reload sources: %v", err)
+		}
+		return fmt.Sprintf("Now monitoring channel %d via bot %q%s", id, sourceBotName, targetsSuffix(targets))
+
+	case "addgroup":
+		if len(args) < 2 {
+			return "Usage: /addgroup <id|@username> <user_ids...> [bot=<name>] [to <target_ids...>]"
+		}
+		args, sourceBotName := extractBotOverride(args, botName)
+		rest, targets, err := splitTargetArgs(args)
+		if err != nil {
+			return err.Error()
+		}
+		if len(rest) < 2 {
+			return "Usage: /addgroup <id|@username> <user_ids...> [bot=<name>] [to <target_ids...>]"
+		}
+		userIDs, err := parseInt64List(rest[1:])
+		if err != nil {
+			return err.Error()
+		}
+		if err := config.store.AddGroup(rest[0], sourceBotName, userIDs, targets); err != nil {
+			return fmt.Sprintf("Error adding group: %v", err)
+		}
+		if err := config.reloadSources(); err != nil {
+			return fmt.Sprintf("Group added but failed to reload sources: %v", err)
+		}
+		return fmt.Sprintf("Now monitoring group %s via bot %q for users %v%s", rest[0], sourceBotName, userIDs, targetsSuffix(targets))
+
+	case "adduser":
+		if len(args) < 1 {
+			return "Usage: /adduser <user_id> [bot=<name>] [to <target_ids...>]"
+		}
+		args, sourceBotName := extractBotOverride(args, botName)
+		rest, targets, err := splitTargetArgs(args)
+		if err != nil {
+			return err.Error()
+		}
+		if len(rest) != 1 {
+			return "Usage: /adduser <user_id> [bot=<name>] [to <target_ids...>]"
+		}
+		userID, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			return fmt.Sprintf("Invalid user ID: %v", err)
+		}
+		if err := config.store.AddUser(userID, sourceBotName, targets); err != nil {
+			return fmt.Sprintf("Error adding user: %v", err)
+		}
+		if err := config.reloadSources(); err != nil {
+			return fmt.Sprintf("User added but failed to reload sources: %v", err)
+		}
+		return fmt.Sprintf("Now monitoring direct messages from user %d via bot %q%s", userID, sourceBotName, targetsSuffix(targets))
+
+	case "removesource":
+		if len(args) != 1 {
+			return "Usage: /removesource <n> (see /listsources for numbers)"
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Sprintf("Invalid source number: %v", err)
+		}
+		if err := config.store.Remove(n); err != nil {
+			return fmt.Sprintf("Error removing source: %v", err)
+		}
+		if err := config.reloadSources(); err != nil {
+			return fmt.Sprintf("Source removed but failed to reload sources: %v", err)
+		}
+		return fmt.Sprintf("Removed source %d", n)
+
+	case "listsources":
+		sources := config.sourcesSnapshot()
+		if len(sources) == 0 {
+			return "No sources are currently monitored."
+		}
+		var b strings.Builder
+		for i, source := range sources {
+			fmt.Fprintf(&b, "%d. %s", i+1, source.Type)
+			if source.ID != 0 {
+				fmt.Fprintf(&b, " id=%d", source.ID)
+			}
+			if source.Username != "" {
+				fmt.Fprintf(&b, " @%s", source.Username)
+			}
+			if len(source.UserIDs) > 0 {
+				fmt.Fprintf(&b, " users=%v", source.UserIDs)
+			}
+			fmt.Fprintf(&b, " bot=%s", source.BotName)
+			fmt.Fprint(&b, targetsSuffix(source.Targets))
+			if source.Filters != nil {
+				b.WriteString(" [filtered]")
+			}
+			b.WriteString("\n")
+		}
+		return b.String()
+
+	case "setfilter":
+		if len(args) < 2 {
+			return "Usage: /setfilter <n> include=a,b exclude=c regex=d fuzzy=e types=text,photo,video,document,link"
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Sprintf("Invalid source number: %v", err)
+		}
+		filters, err := parseFilterArgs(args[1:])
+		if err != nil {
+			return err.Error()
+		}
+		if err := config.store.SetFilters(n, filters); err != nil {
+			return fmt.Sprintf("Error setting filters: %v", err)
+		}
+		if err := config.reloadSources(); err != nil {
+			return fmt.Sprintf("Filters set but failed to reload sources: %v", err)
+		}
+		return fmt.Sprintf("Updated filters for source %d", n)
+
+	case "clearfilter":
+		if len(args) != 1 {
+			return "Usage: /clearfilter <n>"
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Sprintf("Invalid source number: %v", err)
+		}
+		if err := config.store.ClearFilters(n); err != nil {
+			return fmt.Sprintf("Error clearing filters: %v", err)
+		}
+		if err := config.reloadSources(); err != nil {
+			return fmt.Sprintf("Filters cleared but failed to reload sources: %v", err)
+		}
+		return fmt.Sprintf("Cleared filters for source %d", n)
+	}
+
+	return "I don't know that command. Use /help to see available commands."
+}
+
+// validMessageTypes are the message-type tokens messageTypeMatches knows
+// how to check.
+var validMessageTypes = map[string]bool{
+	"text":     true,
+	"photo":    true,
+	"video":    true,
+	"document": true,
+	"link":     true,
+}
+
+// parseFilterArgs parses /setfilter's key=value,value2 arguments into a
+// Filters. Recognized keys: include, exclude, regex, fuzzy, types. Regexes
+// are compiled and type names validated here, before the filters are ever
+// persisted, so a bad pattern or typo'd type is rejected immediately instead
+// of bricking the source (or, on the next restart, the whole process) later.
+func parseFilterArgs(args []string) (Filters, error) {
+	var filters Filters
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return Filters{}, fmt.Errorf("invalid filter %q, expected key=value", arg)
+		}
+		values := nonEmptyTokens(value)
+		if len(values) == 0 {
+			return Filters{}, fmt.Errorf("filter %q has no values", arg)
+		}
+		switch key {
+		case "include":
+			filters.IncludeKeywords = append(filters.IncludeKeywords, values...)
+		case "exclude":
+			filters.ExcludeKeywords = append(filters.ExcludeKeywords, values...)
+		case "regex":
+			for _, pattern := range values {
+				if _, err := regexp.Compile(pattern); err != nil {
+					return Filters{}, fmt.Errorf("invalid regex %q: %v", pattern, err)
+				}
+			}
+			filters.IncludeRegexes = append(filters.IncludeRegexes, values...)
+		case "fuzzy":
+			filters.FuzzyInclude = append(filters.FuzzyInclude, values...)
+		case "types":
+			for _, t := range values {
+				if !validMessageTypes[t] {
+					return Filters{}, fmt.Errorf("unknown message type %q", t)
+				}
+			}
+			filters.MessageTypes = append(filters.MessageTypes, values...)
+		default:
+			return Filters{}, fmt.Errorf("unknown filter key %q", key)
+		}
+	}
+	return filters, nil
+}
+
+// nonEmptyTokens splits value on commas and drops empty tokens, so a
+// trailing comma (e.g. "exclude=spam,") doesn't produce a blank keyword
+// that would match every message.
+func nonEmptyTokens(value string) []string {
+	var tokens []string
+	for _, token := range strings.Split(value, ",") {
+		if token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func parseInt64List(args []string) ([]int64, error) {
+	ids := make([]int64, 0, len(args))
+	for _, a := range args {
+		id, err := strconv.ParseInt(a, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q: %v", a, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// extractBotOverride pulls a "bot=<name>" argument out of args, returning the
+// remaining args and the resolved owning bot name: the override if present,
+// otherwise defaultBotName (the bot that received the command).
+func extractBotOverride(args []string, defaultBotName string) (rest []string, botName string) {
+	botName = defaultBotName
+	rest = make([]string, 0, len(args))
+	for _, a := range args {
+		if name, ok := strings.CutPrefix(a, "bot="); ok {
+			botName = name
+			continue
+		}
+		rest = append(rest, a)
+	}
+	return rest, botName
+}
+
+// parseTargets parses a list of target arguments of the form "<channel_id>"
+// or "<channel_id>@<bot_name>" into Targets. An empty BotName on the result
+// means "whichever bot owns the source".
+func parseTargets(args []string) ([]Target, error) {
+	targets := make([]Target, 0, len(args))
+	for _, a := range args {
+		idPart, botName, _ := strings.Cut(a, "@")
+		id, err := strconv.ParseInt(idPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %q: %v", a, err)
+		}
+		targets = append(targets, Target{ChannelID: id, BotName: botName})
+	}
+	return targets, nil
+}
+
+// splitTargetArgs splits command args on a "to" keyword, separating the
+// source's own arguments from a trailing list of targets, e.g.
+// "/addgroup -100 111 222 to -200 -300@other" ->
+// (["-100", "111", "222"], [{-200, ""}, {-300, "other"}]).
+func splitTargetArgs(args []string) (rest []string, targets []Target, err error) {
+	for i, a := range args {
+		if strings.EqualFold(a, "to") {
+			targets, err = parseTargets(args[i+1:])
+			if err != nil {
+				return nil, nil, err
+			}
+			return args[:i], targets, nil
+		}
+	}
+	return args, nil, nil
+}
+
+// targetsSuffix renders a source's target override for inclusion in a chat
+// reply, or an empty string when the source uses the default target.
+func targetsSuffix(targets []Target) string {
+	if len(targets) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(targets))
+	for _, t := range targets {
+		if t.BotName == "" {
+			parts = append(parts, strconv.FormatInt(t.ChannelID, 10))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d@%s", t.ChannelID, t.BotName))
+		}
+	}
+	return fmt.Sprintf(" -> [%s]", strings.Join(parts, ", "))
+}
+
+// forwardMessage queues a message for delivery to every target instead of
+// sending it inline, so a rate limit or transient failure doesn't drop it:
+// drainForwardQueue retries queued jobs with backoff. Queueing also
+// deduplicates by (fromChatID, messageID, target), so replaying the same
+// update after a restart won't double-post.
+func forwardMessage(config *Config, targets []Target, fromChatID int64, messageID int) {
+	for _, target := range targets {
+		if err := config.queue.Enqueue(fromChatID, messageID, target); err != nil {
+			log.Printf("Error queuing forward to %d: %v", target.ChannelID, err)
+		}
 	}
 }
 
-func monitorPublicGroups(bot *tgbotapi.BotAPI, config *Config) {
-	log.Println("Starting monitoring of public groups...")
+func monitorPublicGroups(bot *tgbotapi.BotAPI, botName string, config *Config) {
+	log.Printf("Starting monitoring of public groups for bot %q...", botName)
 
 	publicGroups := make([]string, 0)
-	for _, source := range config.Sources {
-		if source.Type == "public_group" && source.Username != "" {
+	for _, source := range config.sourcesSnapshot() {
+		if source.BotName == botName && source.Type == "public_group" && source.Username != "" {
 			publicGroups = append(publicGroups, source.Username)
 		}
 	}
@@ -292,10 +985,9 @@ func monitorPublicGroups(bot *tgbotapi.BotAPI, config *Config) {
 
 	log.Printf("Monitoring the following public groups: %v", publicGroups)
 
-	// Since we can't directly monitor public groups without joining them,
-	// Let the user know they need to set up a webhook or join the groups
-	log.Println("NOTE: To monitor public groups without joining them, you need to:")
-	log.Println("1. Join the target groups with your bot")
-	log.Println("2. Or use a webhook approach by setting up a public endpoint")
-	log.Println("Telegram API doesn't allow getting messages from groups the bot hasn't joined")
+	// Telegram doesn't allow reading messages from groups the bot hasn't
+	// joined, webhook or not, so the bot still needs to be a member of
+	// each public group listed above.
+	log.Println("NOTE: the bot must join these public groups to receive their messages")
+	log.Println("Run with TELEGRAM_MODE=webhook if you need a public HTTPS endpoint instead of polling")
 }
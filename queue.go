@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// forwardJob is a single queued forward: a message, identified by where it
+// came from, and where it's going. Dedup'd on (FromChatID, MessageID,
+// TargetID), so replaying the same update after a restart won't double-post.
+type forwardJob struct {
+	gorm.Model
+	FromChatID    int64
+	MessageID     int
+	TargetID      int64
+	BotName       string
+	Attempts      int
+	NextAttemptAt time.Time
+	Delivered     bool
+}
+
+// ForwardQueue persists outbound forwards so a flaky network or Telegram's
+// flood control doesn't silently drop them: forwardMessage enqueues, and a
+// worker goroutine (see drain) sends them with exponential backoff.
+type ForwardQueue struct {
+	db *gorm.DB
+}
+
+func openForwardQueue(db *gorm.DB) (*ForwardQueue, error) {
+	if err := db.AutoMigrate(&forwardJob{}); err != nil {
+		return nil, fmt.Errorf("error migrating forward queue: %v", err)
+	}
+	return &ForwardQueue{db: db}, nil
+}
+
+// Enqueue adds one forward job, unless an identical (from, message, target)
+// job is already queued or has already been delivered.
+func (q *ForwardQueue) Enqueue(fromChatID int64, messageID int, target Target) error {
+	var existing forwardJob
+	err := q.db.Where("from_chat_id = ? AND message_id = ? AND target_id = ?", fromChatID, messageID, target.ChannelID).
+		First(&existing).Error
+	if err == nil {
+		return nil // already queued or delivered
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("error checking for existing forward job: %v", err)
+	}
+
+	return q.db.Create(&forwardJob{
+		FromChatID:    fromChatID,
+		MessageID:     messageID,
+		TargetID:      target.ChannelID,
+		BotName:       target.BotName,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// due returns undelivered jobs whose next attempt is not in the future.
+func (q *ForwardQueue) due() ([]forwardJob, error) {
+	var jobs []forwardJob
+	err := q.db.Where("delivered = ? AND next_attempt_at <= ?", false, time.Now()).Order("id").Find(&jobs).Error
+	return jobs, err
+}
+
+func (q *ForwardQueue) markDelivered(job forwardJob) error {
+	return q.db.Model(&job).Update("delivered", true).Error
+}
+
+// reschedule bumps a job's attempt count and pushes its next attempt out by
+// delay, capping attempts so a permanently-failing job doesn't retry forever.
+func (q *ForwardQueue) reschedule(job forwardJob, delay time.Duration) error {
+	return q.db.Model(&job).Updates(map[string]any{
+		"attempts":        job.Attempts + 1,
+		"next_attempt_at": time.Now().Add(delay),
+	}).Error
+}
+
+const maxForwardAttempts = 10
+
+// backoff returns how long to wait before the next attempt: Telegram's own
+// RetryAfter when it told us to back off, otherwise an exponential delay
+// capped at 5 minutes.
+func backoff(attempts int, retryAfter int) time.Duration {
+	if retryAfter > 0 {
+		return time.Duration(retryAfter) * time.Second
+	}
+	delay := time.Duration(math.Pow(2, float64(attempts))) * time.Second
+	if cap := 5 * time.Minute; delay > cap {
+		delay = cap
+	}
+	return delay
+}
+
+// drainForwardQueue runs until stop is closed, periodically sending every due
+// job and rescheduling failures with backoff.
+func drainForwardQueue(queue *ForwardQueue, bots *BotSet, stop <-chan struct{}) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			jobs, err := queue.due()
+			if err != nil {
+				log.Printf("Error listing due forward jobs: %v", err)
+				continue
+			}
+			for _, job := range jobs {
+				deliverJob(queue, bots, job)
+			}
+		}
+	}
+}
+
+func deliverJob(queue *ForwardQueue, bots *BotSet, job forwardJob) {
+	bot, resolvedName := bots.resolve(job.BotName)
+	forward := tgbotapi.NewForward(job.TargetID, job.FromChatID, job.MessageID)
+
+	_, err := bot.Send(forward)
+	if err == nil {
+		if err := queue.markDelivered(job); err != nil {
+			log.Printf("Error marking forward job %d delivered: %v", job.ID, err)
+		}
+		log.Printf("Successfully forwarded message from chat %d to %d via bot %q", job.FromChatID, job.TargetID, resolvedName)
+		return
+	}
+
+	if job.Attempts+1 >= maxForwardAttempts {
+		log.Printf("Giving up on forward job %d to %d after %d attempts: %v", job.ID, job.TargetID, job.Attempts+1, err)
+		if markErr := queue.markDelivered(job); markErr != nil {
+			log.Printf("Error marking exhausted forward job %d delivered: %v", job.ID, markErr)
+		}
+		return
+	}
+
+	var tgErr *tgbotapi.Error
+	retryAfter := 0
+	if errors.As(err, &tgErr) {
+		retryAfter = tgErr.RetryAfter
+	}
+	delay := backoff(job.Attempts, retryAfter)
+
+	log.Printf("Error forwarding message to %d via bot %q (attempt %d): %v; retrying in %s", job.TargetID, resolvedName, job.Attempts+1, err, delay)
+	if err := queue.reschedule(job, delay); err != nil {
+		log.Printf("Error rescheduling forward job %d: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// sourceRecord, sourceUserID and sourceTarget are the GORM models backing
+// the `sources`, `source_user_ids` and `source_targets` tables that persist
+// the monitored source list.
+type sourceRecord struct {
+	gorm.Model
+	Type     string
+	SourceID int64 // Telegram channel/group ID, when known
+	Username string
+	BotName  string         // the bot this source was added through, and reads from
+	UserIDs  []sourceUserID `gorm:"foreignKey:SourceRecordID"`
+	Targets  []sourceTarget `gorm:"foreignKey:SourceRecordID"`
+	Filters  []sourceFilter `gorm:"foreignKey:SourceRecordID"`
+}
+
+type sourceUserID struct {
+	gorm.Model
+	SourceRecordID uint
+	UserID         int64
+}
+
+// sourceTarget overrides, per source, which channel(s) matched messages are
+// forwarded to. An empty set means the source falls back to the top-level
+// default target. An empty BotName means "whichever bot owns the source".
+type sourceTarget struct {
+	gorm.Model
+	SourceRecordID uint
+	ChannelID      int64
+	BotName        string
+}
+
+// sourceFilter is one content-filter rule attached to a source. Kind is one
+// of include_keyword, exclude_keyword, include_regex, fuzzy_include or
+// message_type; Value holds that rule's single keyword/pattern/type.
+type sourceFilter struct {
+	gorm.Model
+	SourceRecordID uint
+	Kind           string
+	Value          string
+}
+
+// SourceStore persists the monitored source list in SQLite so operators can
+// add or remove sources at runtime via chat commands instead of editing
+// config.json and restarting the process.
+type SourceStore struct {
+	db *gorm.DB
+}
+
+// DB returns the underlying connection, so other stores (e.g. ForwardQueue)
+// can share the same SQLite file instead of opening a second connection.
+func (s *SourceStore) DB() *gorm.DB {
+	return s.db
+}
+
+func openSourceStore(path string) (*SourceStore, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("error opening source store: %v", err)
+	}
+	if err := db.AutoMigrate(&sourceRecord{}, &sourceUserID{}, &sourceTarget{}, &sourceFilter{}); err != nil {
+		return nil, fmt.Errorf("error migrating source store: %v", err)
+	}
+	return &SourceStore{db: db}, nil
+}
+
+// List returns every stored source in insertion order.
+func (s *SourceStore) List() ([]Source, error) {
+	var records []sourceRecord
+	if err := s.db.Preload("UserIDs").Preload("Targets").Preload("Filters").Order("id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("error listing sources: %v", err)
+	}
+
+	sources := make([]Source, 0, len(records))
+	for _, record := range records {
+		source := Source{
+			Type:     record.Type,
+			ID:       record.SourceID,
+			Username: record.Username,
+			BotName:  record.BotName,
+		}
+		for _, u := range record.UserIDs {
+			source.UserIDs = append(source.UserIDs, u.UserID)
+		}
+		for _, t := range record.Targets {
+			source.Targets = append(source.Targets, Target{ChannelID: t.ChannelID, BotName: t.BotName})
+		}
+		if len(record.Filters) > 0 {
+			source.Filters = filtersFromRows(record.Filters)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+func filtersFromRows(rows []sourceFilter) *Filters {
+	filters := &Filters{}
+	for _, row := range rows {
+		switch row.Kind {
+		case "include_keyword":
+			filters.IncludeKeywords = append(filters.IncludeKeywords, row.Value)
+		case "exclude_keyword":
+			filters.ExcludeKeywords = append(filters.ExcludeKeywords, row.Value)
+		case "include_regex":
+			filters.IncludeRegexes = append(filters.IncludeRegexes, row.Value)
+		case "fuzzy_include":
+			filters.FuzzyInclude = append(filters.FuzzyInclude, row.Value)
+		case "message_type":
+			filters.MessageTypes = append(filters.MessageTypes, row.Value)
+		}
+	}
+	return filters
+}
+
+func (s *SourceStore) AddChannel(id int64, botName string, targets []Target) error {
+	return s.db.Create(&sourceRecord{
+		Type:     "channel",
+		SourceID: id,
+		BotName:  botName,
+		Targets:  toSourceTargets(targets),
+	}).Error
+}
+
+// AddGroup stores a monitored group. idOrUsername is treated as a numeric
+// chat ID when it parses as one, and otherwise as a public group @username.
+func (s *SourceStore) AddGroup(idOrUsername string, botName string, userIDs []int64, targets []Target) error {
+	record := sourceRecord{Type: "group", BotName: botName, Targets: toSourceTargets(targets)}
+	if id, err := strconv.ParseInt(idOrUsername, 10, 64); err == nil {
+		record.SourceID = id
+	} else {
+		record.Type = "public_group"
+		record.Username = strings.TrimPrefix(idOrUsername, "@")
+	}
+	for _, userID := range userIDs {
+		record.UserIDs = append(record.UserIDs, sourceUserID{UserID: userID})
+	}
+	return s.db.Create(&record).Error
+}
+
+func (s *SourceStore) AddUser(userID int64, botName string, targets []Target) error {
+	return s.db.Create(&sourceRecord{
+		Type:    "user",
+		BotName: botName,
+		UserIDs: []sourceUserID{{UserID: userID}},
+		Targets: toSourceTargets(targets),
+	}).Error
+}
+
+func toSourceTargets(targets []Target) []sourceTarget {
+	rows := make([]sourceTarget, 0, len(targets))
+	for _, t := range targets {
+		rows = append(rows, sourceTarget{ChannelID: t.ChannelID, BotName: t.BotName})
+	}
+	return rows
+}
+
+// recordAt returns the source record at the given 1-based position, matching
+// the numbering shown by the /listsources command.
+func (s *SourceStore) recordAt(n int) (sourceRecord, error) {
+	var records []sourceRecord
+	if err := s.db.Order("id").Find(&records).Error; err != nil {
+		return sourceRecord{}, fmt.Errorf("error listing sources: %v", err)
+	}
+	if n < 1 || n > len(records) {
+		return sourceRecord{}, fmt.Errorf("no source numbered %d", n)
+	}
+	return records[n-1], nil
+}
+
+// Remove deletes the source at the given 1-based position.
+func (s *SourceStore) Remove(n int) error {
+	record, err := s.recordAt(n)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Where("source_record_id = ?", record.ID).Delete(&sourceUserID{}).Error; err != nil {
+		return fmt.Errorf("error removing source user ids: %v", err)
+	}
+	if err := s.db.Where("source_record_id = ?", record.ID).Delete(&sourceTarget{}).Error; err != nil {
+		return fmt.Errorf("error removing source targets: %v", err)
+	}
+	if err := s.db.Where("source_record_id = ?", record.ID).Delete(&sourceFilter{}).Error; err != nil {
+		return fmt.Errorf("error removing source filters: %v", err)
+	}
+	return s.db.Delete(&record).Error
+}
+
+// SetFilters replaces the content filters on the source at the given
+// 1-based position. It rejects an invalid regex or unknown message type
+// before writing anything, so a bad /setfilter can't brick the source (or,
+// on the next restart, the whole process).
+func (s *SourceStore) SetFilters(n int, filters Filters) error {
+	if err := filters.compile(); err != nil {
+		return err
+	}
+	for _, t := range filters.MessageTypes {
+		if !validMessageTypes[t] {
+			return fmt.Errorf("unknown message type %q", t)
+		}
+	}
+
+	record, err := s.recordAt(n)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Where("source_record_id = ?", record.ID).Delete(&sourceFilter{}).Error; err != nil {
+		return fmt.Errorf("error clearing existing filters: %v", err)
+	}
+
+	var rows []sourceFilter
+	appendRows := func(kind string, values []string) {
+		for _, value := range values {
+			rows = append(rows, sourceFilter{SourceRecordID: record.ID, Kind: kind, Value: value})
+		}
+	}
+	appendRows("include_keyword", filters.IncludeKeywords)
+	appendRows("exclude_keyword", filters.ExcludeKeywords)
+	appendRows("include_regex", filters.IncludeRegexes)
+	appendRows("fuzzy_include", filters.FuzzyInclude)
+	appendRows("message_type", filters.MessageTypes)
+
+	if len(rows) == 0 {
+		return nil
+	}
+	return s.db.Create(&rows).Error
+}
+
+// ClearFilters removes all content filters from the source at the given
+// 1-based position, so it forwards every message again.
+func (s *SourceStore) ClearFilters(n int) error {
+	return s.SetFilters(n, Filters{})
+}